@@ -0,0 +1,100 @@
+package pcap
+
+import (
+	"log"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcap"
+	"golang.org/x/sys/unix"
+
+	"github.com/hwipl/packet-go/pkg/rawsocket"
+)
+
+// afpacketSource adapts a rawsocket.RawSocket's zero-copy TPACKET_V3 ring to
+// gopacket.ZeroCopyPacketDataSource so it can be driven the same way the
+// "pcap" backend drives a pcap.Handle
+type afpacketSource struct {
+	sock *rawsocket.RawSocket
+}
+
+// ZeroCopyReadPacketData implements gopacket.ZeroCopyPacketDataSource
+func (s *afpacketSource) ZeroCopyReadPacketData() ([]byte, gopacket.CaptureInfo, error) {
+	data, err := s.sock.Recv()
+	if err != nil {
+		return nil, gopacket.CaptureInfo{}, err
+	}
+	ci := gopacket.CaptureInfo{
+		Timestamp:     time.Now(),
+		CaptureLength: len(data),
+		Length:        len(data),
+	}
+	return data, ci, nil
+}
+
+// ReadPacketData implements gopacket.PacketDataSource, which
+// gopacket.NewPacketSource requires; it returns a copy of the packet data
+// that stays valid after the next read
+func (s *afpacketSource) ReadPacketData() ([]byte, gopacket.CaptureInfo, error) {
+	data, ci, err := s.ZeroCopyReadPacketData()
+	if err != nil {
+		return nil, ci, err
+	}
+	return append([]byte(nil), data...), ci, nil
+}
+
+// prepareAfpacket sets up the afpacket backend: a raw socket with a
+// TPACKET_V3 receive ring, optional BPF filter and a gopacket.PacketSource
+// reading from it
+func (l *Listener) prepareAfpacket() *gopacket.PacketSource {
+	if l.Device == "" {
+		l.getFirstPcapInterface()
+	}
+
+	sock := rawsocket.NewRawSocket(l.Device)
+	snaplen := uint32(l.Snaplen)
+	if snaplen == 0 {
+		snaplen = 65536
+	}
+	err := sock.EnableRxRing(rawsocket.RxRing{
+		BlockSize:       1 << 20,
+		BlockCount:      64,
+		FrameSize:       snaplen,
+		RetireTimeoutMs: 100,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if l.Filter != "" {
+		insns, err := pcap.CompileBPFFilter(layers.LinkTypeEthernet,
+			int(snaplen), l.Filter)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := sock.SetFilter(toSockFilter(insns)); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	l.afsock = sock
+	return gopacket.NewPacketSource(&afpacketSource{sock: sock},
+		layers.LayerTypeEthernet)
+}
+
+// toSockFilter converts compiled libpcap BPF instructions to the classic
+// BPF program format unix.SetsockoptSockFprog/SO_ATTACH_FILTER expects,
+// preserving Listener.Filter's semantics for the afpacket backend
+func toSockFilter(insns []pcap.BPFInstruction) []unix.SockFilter {
+	filter := make([]unix.SockFilter, len(insns))
+	for i, insn := range insns {
+		filter[i] = unix.SockFilter{
+			Code: insn.Code,
+			Jt:   insn.Jt,
+			Jf:   insn.Jf,
+			K:    insn.K,
+		}
+	}
+	return filter
+}
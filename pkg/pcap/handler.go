@@ -0,0 +1,15 @@
+package pcap
+
+import "github.com/google/gopacket"
+
+// PacketHandler is implemented by users of Listener to handle packets
+// received by the listener
+type PacketHandler interface {
+	HandlePacket(packet gopacket.Packet)
+}
+
+// TimerHandler is implemented by users of Listener to handle timer events
+// configured with Listener.Timer
+type TimerHandler interface {
+	HandleTimer()
+}
@@ -2,17 +2,40 @@ package pcap
 
 import (
 	"fmt"
+	"io"
 	"log"
 	"time"
 
 	"github.com/google/gopacket"
 	"github.com/google/gopacket/pcap"
+
+	"github.com/hwipl/packet-go/pkg/rawsocket"
 )
 
+// RotatePolicy configures when Listener rotates its OutFile dump
+type RotatePolicy struct {
+	// MaxFileSize rotates the dump file once the captured packet bytes
+	// written to it would exceed this value; file and per-packet headers
+	// are not counted; 0 disables size based rotation
+	MaxFileSize int64
+
+	// RotateInterval rotates the dump file once it has been open for
+	// longer than this duration; 0 disables time based rotation
+	RotateInterval time.Duration
+}
+
 // Listener is a pcap listener that reads packets from a file or device and
 // calls Handlers for packets and timer events
 type Listener struct {
 	pcapHandle *pcap.Handle
+	afsock     *rawsocket.RawSocket
+	packets    *gopacket.PacketSource
+	dump       PacketHandler
+
+	// Backend selects the packet source: "pcap" (the default) uses
+	// libpcap via pcapHandle, "afpacket" uses a zero-copy TPACKET_V3
+	// ring on rawsocket.RawSocket instead
+	Backend string
 
 	PacketHandler PacketHandler
 
@@ -27,6 +50,22 @@ type Listener struct {
 	Filter  string
 	MaxPkts int
 	MaxTime time.Duration
+
+	// OutFile, if set, makes Listener dump every received packet to
+	// this file, turning it into a tcpdump-style capture tool; it is
+	// only used with the "pcap" Backend and ignored with "afpacket"
+	OutFile string
+
+	// OutFormat selects the dump file format: "pcap" (the default) or
+	// "pcapng", which additionally preserves interface metadata
+	OutFormat string
+
+	// OutGzip gzip-compresses OutFile; only supported with the "pcap"
+	// OutFormat
+	OutGzip bool
+
+	// RotatePolicy configures rotation of OutFile
+	RotatePolicy RotatePolicy
 }
 
 // getFirstPcapInterface sets the first network interface found by pcap
@@ -44,6 +83,12 @@ func (l *Listener) getFirstPcapInterface() {
 
 // Prepare prepares the pcap listener for the listen function
 func (l *Listener) Prepare() {
+	if l.Backend == "afpacket" {
+		l.packets = l.prepareAfpacket()
+		log.Printf("Listening on interface %s (afpacket):\n", l.Device)
+		return
+	}
+
 	// open pcap handle
 	var pcapErr error
 	var startText string
@@ -78,22 +123,66 @@ func (l *Listener) Prepare() {
 			log.Fatal(pcapErr)
 		}
 	}
+	if l.OutFile != "" {
+		l.prepareDump()
+	}
+	l.packets = gopacket.NewPacketSource(l.pcapHandle, l.pcapHandle.LinkType())
 	log.Printf(startText)
 }
 
+// prepareDump sets up dumping of received packets to OutFile
+func (l *Listener) prepareDump() {
+	switch l.OutFormat {
+	case "", "pcap":
+		w := NewWriter(l.OutFile, l.pcapHandle.LinkType(), l.Snaplen,
+			l.RotatePolicy)
+		if l.OutGzip {
+			// NewWriter already opened the first file uncompressed;
+			// reopen it under the same name with gzip enabled
+			w.Gzip = true
+			w.seq--
+			w.rotate()
+		}
+		l.dump = &DumpHandler{Writer: w}
+	case "pcapng":
+		w := NewNgWriter(l.OutFile, l.Device, l.pcapHandle, l.RotatePolicy)
+		l.dump = &NgDumpHandler{Writer: w}
+	default:
+		log.Fatalf("unknown output format %q", l.OutFormat)
+	}
+}
+
+// Stop closes the packet source opened by Prepare, causing a concurrently
+// running Loop to return. It is safe to call once Prepare has returned, and
+// safe to call more than once or together with Loop's own cleanup.
+func (l *Listener) Stop() {
+	if l.pcapHandle != nil {
+		l.pcapHandle.Close()
+	}
+	if l.afsock != nil {
+		l.afsock.Close()
+	}
+}
+
 // Loop implements the listen loop for the listen function
 func (l *Listener) Loop() {
-	defer l.pcapHandle.Close()
+	if l.pcapHandle != nil {
+		defer l.pcapHandle.Close()
+	}
+	if l.afsock != nil {
+		defer l.afsock.Close()
+	}
+	if closer, ok := l.dump.(io.Closer); ok {
+		defer closer.Close()
+	}
 
 	// make sure there is a packet handler
-	if l.PacketHandler == nil {
+	if l.PacketHandler == nil && l.dump == nil {
 		log.Fatal("no packet handler set")
 	}
 
-	// Use the handle as a packet source to process all packets
-	packetSource := gopacket.NewPacketSource(l.pcapHandle,
-		l.pcapHandle.LinkType())
-	packets := packetSource.Packets()
+	// use the packet source set up by Prepare to process all packets
+	packets := l.packets.Packets()
 
 	// setup timer and check timer handler
 	ticker := time.Tick(l.Timer)
@@ -115,7 +204,12 @@ func (l *Listener) Loop() {
 			if packet == nil {
 				return
 			}
-			l.PacketHandler.HandlePacket(packet)
+			if l.dump != nil {
+				l.dump.HandlePacket(packet)
+			}
+			if l.PacketHandler != nil {
+				l.PacketHandler.HandlePacket(packet)
+			}
 			count++
 			if l.MaxPkts > 0 && count == l.MaxPkts {
 				return
@@ -0,0 +1,171 @@
+package pcap
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+)
+
+// Writer writes packets to a pcap file, rotating the file by size or time
+// if configured
+type Writer struct {
+	// MaxFileSize rotates the file once the captured packet bytes written
+	// to it would exceed this value; the file header and per-packet
+	// record headers are not counted; 0 disables size based rotation
+	MaxFileSize int64
+
+	// RotateInterval rotates the file once it has been open for longer
+	// than this duration; 0 disables time based rotation
+	RotateInterval time.Duration
+
+	// Gzip compresses the written file with gzip
+	Gzip bool
+
+	file     string
+	snaplen  int
+	linkType layers.LinkType
+
+	out    io.WriteCloser
+	pcapw  *pcapgo.Writer
+	size   int64
+	opened time.Time
+	seq    int
+}
+
+// NewWriter creates a new Writer that writes packets with link type
+// linkType and snapshot length snaplen to file, rotating according to
+// rotate; if rotation is enabled, file is used as a base name and a
+// sequence number is appended, starting with the very first file
+func NewWriter(file string, linkType layers.LinkType, snaplen int,
+	rotate RotatePolicy) *Writer {
+	w := &Writer{
+		MaxFileSize:    rotate.MaxFileSize,
+		RotateInterval: rotate.RotateInterval,
+		file:           file,
+		snaplen:        snaplen,
+		linkType:       linkType,
+	}
+	w.rotate()
+	return w
+}
+
+// fileName returns the name of the current output file, including a
+// sequence number if rotation is configured
+func (w *Writer) fileName() string {
+	if w.MaxFileSize <= 0 && w.RotateInterval <= 0 {
+		return w.file
+	}
+	return fmt.Sprintf("%s.%d", w.file, w.seq)
+}
+
+// rotate closes the current output file, if any, and opens a new one
+func (w *Writer) rotate() {
+	if w.out != nil {
+		w.out.Close()
+	}
+	w.seq++
+
+	f, err := os.Create(w.fileName())
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var out io.WriteCloser = f
+	if w.Gzip {
+		out = gzipWriteCloser{Writer: gzip.NewWriter(f), f: f}
+	}
+	w.out = out
+
+	pcapw := pcapgo.NewWriter(out)
+	if err := pcapw.WriteFileHeader(uint32(w.snaplen), w.linkType); err != nil {
+		log.Fatal(err)
+	}
+	w.pcapw = pcapw
+
+	w.size = 0
+	w.opened = time.Now()
+}
+
+// needsRotation reports whether the current file should be rotated before
+// writing a packet of length n
+func (w *Writer) needsRotation(n int) bool {
+	if w.MaxFileSize > 0 && w.size+int64(n) > w.MaxFileSize {
+		return true
+	}
+	if w.RotateInterval > 0 && time.Since(w.opened) > w.RotateInterval {
+		return true
+	}
+	return false
+}
+
+// WritePacket writes a packet with capture info ci and contents data,
+// rotating the output file first if necessary
+func (w *Writer) WritePacket(ci gopacket.CaptureInfo, data []byte) error {
+	if w.needsRotation(ci.CaptureLength) {
+		w.rotate()
+	}
+	if err := w.pcapw.WritePacket(ci, data); err != nil {
+		return err
+	}
+	w.size += int64(ci.CaptureLength)
+	return nil
+}
+
+// Close closes the writer's current output file
+func (w *Writer) Close() error {
+	return w.out.Close()
+}
+
+// gzipWriteCloser closes both the gzip writer and the underlying file
+type gzipWriteCloser struct {
+	*gzip.Writer
+	f *os.File
+}
+
+// Close implements io.Closer
+func (g gzipWriteCloser) Close() error {
+	if err := g.Writer.Close(); err != nil {
+		g.f.Close()
+		return err
+	}
+	return g.f.Close()
+}
+
+// DumpHandler is a PacketHandler that persists every packet it sees to a
+// Writer
+type DumpHandler struct {
+	Writer *Writer
+}
+
+// NewDumpHandler creates a DumpHandler that writes packets to file with
+// link type linkType and snapshot length snaplen, rotating as configured by
+// maxFileSize and rotateInterval (either may be 0 to disable that policy)
+func NewDumpHandler(file string, linkType layers.LinkType, snaplen int,
+	maxFileSize int64, rotateInterval time.Duration) *DumpHandler {
+	w := NewWriter(file, linkType, snaplen, RotatePolicy{
+		MaxFileSize:    maxFileSize,
+		RotateInterval: rotateInterval,
+	})
+	return &DumpHandler{Writer: w}
+}
+
+// Close implements io.Closer and closes the underlying Writer
+func (d *DumpHandler) Close() error {
+	return d.Writer.Close()
+}
+
+// HandlePacket implements PacketHandler
+func (d *DumpHandler) HandlePacket(packet gopacket.Packet) {
+	md := packet.Metadata()
+	err := d.Writer.WritePacket(md.CaptureInfo, packet.Data())
+	if err != nil {
+		log.Fatal(err)
+	}
+}
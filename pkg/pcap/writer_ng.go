@@ -0,0 +1,140 @@
+package pcap
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/pcap"
+	"github.com/google/gopacket/pcapgo"
+)
+
+// NgWriter writes packets to a pcapng file; unlike Writer's plain pcap
+// format, the file also records interface metadata (device name, link type
+// and snapshot length) next to the per-packet timestamps
+type NgWriter struct {
+	// MaxFileSize rotates the file once the captured packet bytes written
+	// to it would exceed this value; block headers are not counted; 0
+	// disables size based rotation
+	MaxFileSize int64
+
+	// RotateInterval rotates the file once it has been open for longer
+	// than this duration; 0 disables time based rotation
+	RotateInterval time.Duration
+
+	file  string
+	iface pcapgo.NgInterface
+	seq   int
+
+	out    *os.File
+	ngw    *pcapgo.NgWriter
+	size   int64
+	opened time.Time
+}
+
+// NewNgWriter creates a new NgWriter that writes packets captured from
+// device with pcap.Handle handle to file, recording device's name, handle's
+// link type and snapshot length as the file's interface description, and
+// rotating according to rotate; if rotation is enabled, file is used as a
+// base name and a sequence number is appended, starting with the very first
+// file
+func NewNgWriter(file, device string, handle *pcap.Handle,
+	rotate RotatePolicy) *NgWriter {
+	w := &NgWriter{
+		MaxFileSize:    rotate.MaxFileSize,
+		RotateInterval: rotate.RotateInterval,
+		file:           file,
+		iface: pcapgo.NgInterface{
+			Name:     device,
+			LinkType: handle.LinkType(),
+			SnapLen:  uint32(handle.SnapLen()),
+		},
+	}
+	w.rotate()
+	return w
+}
+
+// fileName returns the name of the current output file, including a
+// sequence number if rotation is configured
+func (w *NgWriter) fileName() string {
+	if w.MaxFileSize <= 0 && w.RotateInterval <= 0 {
+		return w.file
+	}
+	return fmt.Sprintf("%s.%d", w.file, w.seq)
+}
+
+// rotate closes the current output file, if any, and opens a new one with a
+// fresh interface description block
+func (w *NgWriter) rotate() {
+	if w.out != nil {
+		w.out.Close()
+	}
+	w.seq++
+
+	f, err := os.Create(w.fileName())
+	if err != nil {
+		log.Fatal(err)
+	}
+	w.out = f
+
+	ngw, err := pcapgo.NewNgWriterInterface(f, w.iface, pcapgo.DefaultNgWriterOptions)
+	if err != nil {
+		log.Fatal(err)
+	}
+	w.ngw = ngw
+
+	w.size = 0
+	w.opened = time.Now()
+}
+
+// needsRotation reports whether the current file should be rotated before
+// writing a packet of length n
+func (w *NgWriter) needsRotation(n int) bool {
+	if w.MaxFileSize > 0 && w.size+int64(n) > w.MaxFileSize {
+		return true
+	}
+	if w.RotateInterval > 0 && time.Since(w.opened) > w.RotateInterval {
+		return true
+	}
+	return false
+}
+
+// WritePacket writes a packet with capture info ci, which carries the
+// packet's original capture timestamp, and contents data
+func (w *NgWriter) WritePacket(ci gopacket.CaptureInfo, data []byte) error {
+	if w.needsRotation(ci.CaptureLength) {
+		w.rotate()
+	}
+	if err := w.ngw.WritePacket(ci, data); err != nil {
+		return err
+	}
+	w.size += int64(ci.CaptureLength)
+	return w.ngw.Flush()
+}
+
+// Close closes the writer's current output file
+func (w *NgWriter) Close() error {
+	return w.out.Close()
+}
+
+// NgDumpHandler is a PacketHandler that persists every packet it sees,
+// along with its original capture timestamp, to an NgWriter
+type NgDumpHandler struct {
+	Writer *NgWriter
+}
+
+// Close implements io.Closer and closes the underlying NgWriter
+func (d *NgDumpHandler) Close() error {
+	return d.Writer.Close()
+}
+
+// HandlePacket implements PacketHandler
+func (d *NgDumpHandler) HandlePacket(packet gopacket.Packet) {
+	md := packet.Metadata()
+	err := d.Writer.WritePacket(md.CaptureInfo, packet.Data())
+	if err != nil {
+		log.Fatal(err)
+	}
+}
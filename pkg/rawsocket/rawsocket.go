@@ -3,6 +3,7 @@ package rawsocket
 import (
 	"log"
 	"net"
+	"sync/atomic"
 
 	"golang.org/x/sys/unix"
 )
@@ -13,10 +14,26 @@ type RawSocket struct {
 	devName string
 	dev     *net.Interface
 	addr    *unix.SockaddrLinklayer
+
+	// rx is the mmap'd TPACKET_V3 receive ring set up by EnableRxRing,
+	// or nil if the socket is send-only
+	rx *ring
+
+	// closed is set by Close so a concurrent Recv/Poll can unblock with
+	// io.EOF instead of spinning on errors from the closed fd
+	closed int32
 }
 
-// Close closes the raw socket
+// Close closes the raw socket, releasing its receive ring first if one was
+// set up with EnableRxRing. It is safe to call more than once
 func (r *RawSocket) Close() {
+	if !atomic.CompareAndSwapInt32(&r.closed, 0, 1) {
+		return
+	}
+	if r.rx != nil {
+		unix.Munmap(r.rx.mem)
+		r.rx = nil
+	}
 	unix.Close(r.fd)
 }
 
@@ -49,6 +66,16 @@ func NewRawSocket(device string) *RawSocket {
 		Halen:    6,
 	}
 
+	// bind the socket to device so it only sees device's traffic, not
+	// every interface on the host
+	bindAddr := &unix.SockaddrLinklayer{
+		Protocol: htons(unix.ETH_P_ALL),
+		Ifindex:  dev.Index,
+	}
+	if err := unix.Bind(fd, bindAddr); err != nil {
+		log.Fatal(err)
+	}
+
 	// create raw socket and return it
 	return &RawSocket{
 		fd:      fd,
@@ -0,0 +1,225 @@
+package rawsocket
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"sync/atomic"
+
+	"golang.org/x/sys/unix"
+)
+
+// byteOrder is the in-memory layout of the tpacket_block_desc/tpacket3_hdr
+// structures the kernel fills in, which is the host's native byte order;
+// this module targets little-endian platforms, matching htons_le.go
+var byteOrder = binary.LittleEndian
+
+// RxRing configures the mmap'd TPACKET_V3 ring buffer used by Recv/Poll
+type RxRing struct {
+	// BlockSize is the size in bytes of a single ring block; it must be
+	// a multiple of the page size
+	BlockSize uint32
+
+	// BlockCount is the number of blocks in the ring
+	BlockCount uint32
+
+	// FrameSize is the maximum size of a single captured frame within a
+	// block
+	FrameSize uint32
+
+	// RetireTimeoutMs is how long the kernel waits for a block to fill
+	// up before handing a partially filled block back to user space
+	RetireTimeoutMs uint32
+}
+
+// ring is the mmap'd memory backing an RxRing plus the cursor used to walk
+// it block by block and frame by frame
+type ring struct {
+	cfg   RxRing
+	mem   []byte
+	block int // index of the block currently being read
+	frame int // index of the next frame within the current block
+}
+
+// EnableRxRing switches the raw socket to TPACKET_V3 and sets up an mmap'd
+// receive ring according to cfg, enabling zero-copy reception via Recv/Poll
+func (r *RawSocket) EnableRxRing(cfg RxRing) error {
+	const version = unix.TPACKET_V3
+	if err := unix.SetsockoptInt(r.fd, unix.SOL_PACKET,
+		unix.PACKET_VERSION, version); err != nil {
+		return err
+	}
+
+	req := unix.TpacketReq3{
+		Block_size:       cfg.BlockSize,
+		Block_nr:         cfg.BlockCount,
+		Frame_size:       cfg.FrameSize,
+		Frame_nr:         cfg.BlockSize / cfg.FrameSize * cfg.BlockCount,
+		Retire_blk_tov:   cfg.RetireTimeoutMs,
+		Feature_req_word: 0,
+	}
+	if err := unix.SetsockoptTpacketReq3(r.fd, unix.SOL_PACKET,
+		unix.PACKET_RX_RING, &req); err != nil {
+		return err
+	}
+
+	size := int(cfg.BlockSize * cfg.BlockCount)
+	mem, err := unix.Mmap(r.fd, 0, size,
+		unix.PROT_READ|unix.PROT_WRITE, unix.MAP_SHARED)
+	if err != nil {
+		return err
+	}
+
+	r.rx = &ring{cfg: cfg, mem: mem}
+	return nil
+}
+
+// SetFilter attaches a classic BPF program to the raw socket with
+// SO_ATTACH_FILTER, restricting which packets Recv/Poll return; it
+// preserves the semantics of pcap.Listener's Filter field for the
+// afpacket backend
+func (r *RawSocket) SetFilter(instructions []unix.SockFilter) error {
+	prog := unix.SockFprog{
+		Len:    uint16(len(instructions)),
+		Filter: &instructions[0],
+	}
+	return unix.SetsockoptSockFprog(r.fd, unix.SOL_SOCKET,
+		unix.SO_ATTACH_FILTER, &prog)
+}
+
+// SetFanout joins a PACKET_FANOUT group identified by groupID using fanout
+// mode mode (e.g. unix.PACKET_FANOUT_HASH), letting multiple goroutines
+// share load across a NIC's RX queues
+func (r *RawSocket) SetFanout(groupID uint16, mode uint16) error {
+	arg := int(mode)<<16 | int(groupID)
+	return unix.SetsockoptInt(r.fd, unix.SOL_PACKET,
+		unix.PACKET_FANOUT, arg)
+}
+
+// blockHdrOffset is where struct tpacket_hdr_v1 starts inside a ring block.
+// unix.TpacketBlockDesc is {Version uint32; To_priv uint32; Hdr [40]byte},
+// so the hdr_v1 fields (block_status, num_pkts, offset_to_first_pkt, ...)
+// are preceded by those two uint32s
+const blockHdrOffset = 8
+
+// blockHeader is the part of struct tpacket_hdr_v1 (linux/if_packet.h)
+// needed to walk the ring
+type blockHeader struct {
+	BlockStatus      uint32
+	NumPkts          uint32
+	OffsetToFirstPkt uint32
+}
+
+// blockStatusUser marks a block as owned by user space, i.e. filled in by
+// the kernel and ready to be read
+const blockStatusUser = unix.TP_STATUS_USER
+
+// currentBlock returns the raw bytes of the ring block the cursor is on
+func (rg *ring) currentBlock() []byte {
+	start := rg.block * int(rg.cfg.BlockSize)
+	return rg.mem[start : start+int(rg.cfg.BlockSize)]
+}
+
+// Poll blocks until a packet is available in the ring or the timeout (in
+// milliseconds, -1 for infinite) expires, returning whether data is ready
+func (r *RawSocket) Poll(timeoutMs int) (bool, error) {
+	if r.rx == nil {
+		return false, errors.New("rawsocket: rx ring not enabled")
+	}
+	fds := []unix.PollFd{{Fd: int32(r.fd), Events: unix.POLLIN}}
+	n, err := unix.Poll(fds, timeoutMs)
+	if err != nil {
+		return false, err
+	}
+	return n > 0 && fds[0].Revents&unix.POLLIN != 0, nil
+}
+
+// Recv returns the next packet from the mmap'd receive ring, blocking until
+// one is available. It is zero-copy: the returned slice aliases the ring's
+// mmap'd memory and is only valid until the next call to Recv. Once Close is
+// called, Recv returns io.EOF instead of blocking or erroring on the closed
+// fd, so callers driving it through a gopacket.PacketSource shut down
+// cleanly rather than spinning on read errors
+func (r *RawSocket) Recv() ([]byte, error) {
+	if r.rx == nil {
+		return nil, errors.New("rawsocket: rx ring not enabled")
+	}
+	rg := r.rx
+
+	for {
+		if atomic.LoadInt32(&r.closed) != 0 {
+			return nil, io.EOF
+		}
+
+		block := rg.currentBlock()
+		hdr := parseBlockHeader(block)
+
+		if hdr.BlockStatus&blockStatusUser == 0 {
+			// no block ready yet, wait for one; the wait is bounded
+			// so a concurrent Close is noticed even if no packet
+			// arrives
+			if _, err := r.Poll(100); err != nil {
+				if atomic.LoadInt32(&r.closed) != 0 {
+					return nil, io.EOF
+				}
+				return nil, err
+			}
+			continue
+		}
+
+		if rg.frame >= int(hdr.NumPkts) {
+			// block exhausted, hand it back to the kernel and
+			// move on to the next one
+			setBlockStatusKernel(block)
+			rg.frame = 0
+			rg.block = (rg.block + 1) % int(rg.cfg.BlockCount)
+			continue
+		}
+
+		data := nextFrame(block, hdr, rg.frame)
+		rg.frame++
+		return data, nil
+	}
+}
+
+// parseBlockHeader reads the tpacket_hdr_v1 fields at blockHdrOffset within
+// a ring block
+func parseBlockHeader(block []byte) blockHeader {
+	h := block[blockHdrOffset:]
+	return blockHeader{
+		BlockStatus:      byteOrder.Uint32(h[0:4]),
+		NumPkts:          byteOrder.Uint32(h[4:8]),
+		OffsetToFirstPkt: byteOrder.Uint32(h[8:12]),
+	}
+}
+
+// setBlockStatusKernel marks a fully consumed block as owned by the kernel
+// again so it can be reused for future captures
+func setBlockStatusKernel(block []byte) {
+	byteOrder.PutUint32(block[blockHdrOffset:blockHdrOffset+4],
+		unix.TP_STATUS_KERNEL)
+}
+
+// tpacket3Hdr holds the byte offsets, within a single packet's tpacket3_hdr
+// (linux/if_packet.h), of the fields needed to locate its payload:
+// tp_next_offset at 0, tp_snaplen at 12 and tp_mac at 24
+const (
+	tp3NextOffset = 0
+	tp3SnapLen    = 12
+	tp3Mac        = 24
+)
+
+// nextFrame returns the payload bytes of the packet at index i within
+// block, whose first packet starts at hdr.OffsetToFirstPkt
+func nextFrame(block []byte, hdr blockHeader, i int) []byte {
+	off := int(hdr.OffsetToFirstPkt)
+	for n := 0; n < i; n++ {
+		off += int(byteOrder.Uint32(block[off+tp3NextOffset : off+tp3NextOffset+4]))
+	}
+
+	snapLen := byteOrder.Uint32(block[off+tp3SnapLen : off+tp3SnapLen+4])
+	macOffset := byteOrder.Uint16(block[off+tp3Mac : off+tp3Mac+2])
+
+	start := off + int(macOffset)
+	return block[start : start+int(snapLen)]
+}
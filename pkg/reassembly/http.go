@@ -0,0 +1,62 @@
+package reassembly
+
+import (
+	"bufio"
+	"bytes"
+	"log"
+	"net/http"
+	"net/http/httputil"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/reassembly"
+)
+
+// HTTPHandler is a StreamHandler that parses reassembled streams as HTTP
+// request/response pairs and logs them; it is meant as a minimal example of
+// a protocol decoder built on top of Assembler
+type HTTPHandler struct{}
+
+// NewStream implements StreamHandler
+func (h *HTTPHandler) NewStream(net, transport gopacket.Flow, tcp *layers.TCP) Stream {
+	return &httpStream{net: net, transport: transport}
+}
+
+// httpStream buffers both directions of a TCP connection and, once the
+// stream completes, parses the client data as an HTTP request and the
+// server data as an HTTP response
+type httpStream struct {
+	net, transport gopacket.Flow
+	client, server bytes.Buffer
+}
+
+// ReassembledSG implements Stream
+func (s *httpStream) ReassembledSG(data []byte, ci gopacket.CaptureInfo,
+	dir reassembly.TCPFlowDirection) {
+	if dir == reassembly.TCPDirClientToServer {
+		s.client.Write(data)
+		return
+	}
+	s.server.Write(data)
+}
+
+// ReassemblyComplete implements Stream
+func (s *httpStream) ReassemblyComplete() {
+	req, err := http.ReadRequest(bufio.NewReader(&s.client))
+	if err != nil {
+		log.Printf("%s: could not parse HTTP request: %s",
+			s.transport, err)
+	} else {
+		dump, _ := httputil.DumpRequest(req, false)
+		log.Printf("%s: request: %s", s.transport, dump)
+	}
+
+	resp, err := http.ReadResponse(bufio.NewReader(&s.server), req)
+	if err != nil {
+		log.Printf("%s: could not parse HTTP response: %s",
+			s.transport, err)
+		return
+	}
+	dump, _ := httputil.DumpResponse(resp, false)
+	log.Printf("%s: response: %s", s.transport, dump)
+}
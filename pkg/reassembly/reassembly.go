@@ -0,0 +1,153 @@
+// Package reassembly implements TCP stream reassembly on top of
+// pkg/pcap.Listener, turning raw packets into in-order, deduplicated byte
+// streams per connection and direction.
+package reassembly
+
+import (
+	"log"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/reassembly"
+)
+
+// StreamHandler is implemented by users of Assembler to handle reassembled
+// TCP streams
+type StreamHandler interface {
+	// NewStream is called when a new TCP stream between net and
+	// transport is seen, with the first TCP segment observed on it, and
+	// should return the Stream that handles it
+	NewStream(net, transport gopacket.Flow, tcp *layers.TCP) Stream
+}
+
+// Stream is implemented by users of Assembler to handle the reassembled
+// data of a single TCP stream
+type Stream interface {
+	// ReassembledSG is called with in-order data of the stream as it
+	// becomes available, the capture info of the last packet that
+	// contributed to data, and the direction data was seen in
+	ReassembledSG(data []byte, ci gopacket.CaptureInfo,
+		dir reassembly.TCPFlowDirection)
+
+	// ReassemblyComplete is called when the stream is finished, either
+	// because of a FIN/RST or because it was flushed out by the
+	// assembler
+	ReassemblyComplete()
+}
+
+// streamFactory adapts a StreamHandler to gopacket's reassembly.StreamFactory
+type streamFactory struct {
+	handler StreamHandler
+}
+
+// New implements reassembly.StreamFactory
+func (f *streamFactory) New(netFlow, tcpFlow gopacket.Flow, tcp *layers.TCP,
+	ac reassembly.AssemblerContext) reassembly.Stream {
+	return &streamWrapper{stream: f.handler.NewStream(netFlow, tcpFlow, tcp)}
+}
+
+// streamWrapper adapts a Stream to gopacket's reassembly.Stream
+type streamWrapper struct {
+	stream Stream
+}
+
+// Accept implements reassembly.Stream and accepts every segment
+func (w *streamWrapper) Accept(tcp *layers.TCP, ci gopacket.CaptureInfo,
+	dir reassembly.TCPFlowDirection, nextSeq reassembly.Sequence,
+	start *bool, ac reassembly.AssemblerContext) bool {
+	return true
+}
+
+// ReassembledSG implements reassembly.Stream
+func (w *streamWrapper) ReassembledSG(sg reassembly.ScatterGather,
+	ac reassembly.AssemblerContext) {
+	dir, _, _, _ := sg.Info()
+	length, _ := sg.Lengths()
+	data := sg.Fetch(length)
+	w.stream.ReassembledSG(data, ac.GetCaptureInfo(), dir)
+}
+
+// ReassemblyComplete implements reassembly.Stream
+func (w *streamWrapper) ReassemblyComplete(ac reassembly.AssemblerContext) bool {
+	w.stream.ReassemblyComplete()
+	return true
+}
+
+// Assembler is a pcap.PacketHandler and pcap.TimerHandler that reassembles
+// TCP streams and hands the result to a StreamHandler. It is driven by a
+// pcap.Listener the same way a plain PacketHandler is, by assigning it to
+// Listener.PacketHandler (and, if flushing on a timer is wanted,
+// Listener.TimerHandler and Listener.Timer)
+type Assembler struct {
+	// Handler receives the reassembled streams
+	Handler StreamHandler
+
+	// FlushOlderThan flushes and closes connections that have not seen
+	// activity for longer than this duration; it is checked every time
+	// HandleTimer is called
+	FlushOlderThan time.Duration
+
+	// MaxBufferedPagesPerConnection and MaxBufferedPagesTotal bound the
+	// memory used for out-of-order segments; 0 means unlimited
+	MaxBufferedPagesPerConnection int
+	MaxBufferedPagesTotal         int
+
+	pool      *reassembly.StreamPool
+	assembler *reassembly.Assembler
+}
+
+// prepare lazily creates the underlying gopacket assembler
+func (a *Assembler) prepare() {
+	if a.assembler != nil {
+		return
+	}
+	if a.Handler == nil {
+		log.Fatal("no stream handler set")
+	}
+	a.pool = reassembly.NewStreamPool(&streamFactory{handler: a.Handler})
+	a.assembler = reassembly.NewAssembler(a.pool)
+	if a.MaxBufferedPagesPerConnection > 0 {
+		a.assembler.MaxBufferedPagesPerConnection =
+			a.MaxBufferedPagesPerConnection
+	}
+	if a.MaxBufferedPagesTotal > 0 {
+		a.assembler.MaxBufferedPagesTotal = a.MaxBufferedPagesTotal
+	}
+}
+
+// HandlePacket implements pcap.PacketHandler and feeds packet's TCP layer,
+// if present, into the reassembly engine
+func (a *Assembler) HandlePacket(packet gopacket.Packet) {
+	a.prepare()
+
+	tcp, ok := packet.TransportLayer().(*layers.TCP)
+	if !ok || tcp == nil {
+		return
+	}
+
+	ctx := assemblerContext{ci: packet.Metadata().CaptureInfo}
+	a.assembler.AssembleWithContext(packet.NetworkLayer().NetworkFlow(),
+		tcp, &ctx)
+}
+
+// HandleTimer implements pcap.TimerHandler and flushes connections that
+// have been idle for longer than FlushOlderThan
+func (a *Assembler) HandleTimer() {
+	a.prepare()
+
+	if a.FlushOlderThan <= 0 {
+		return
+	}
+	a.assembler.FlushCloseOlderThan(time.Now().Add(-a.FlushOlderThan))
+}
+
+// assemblerContext implements reassembly.AssemblerContext
+type assemblerContext struct {
+	ci gopacket.CaptureInfo
+}
+
+// GetCaptureInfo implements reassembly.AssemblerContext
+func (c *assemblerContext) GetCaptureInfo() gopacket.CaptureInfo {
+	return c.ci
+}
@@ -0,0 +1,178 @@
+// Package replay implements a traffic generation pipeline that transmits
+// previously synthesized or captured packets over a rawsocket.RawSocket
+// with realistic timing.
+package replay
+
+import (
+	"log"
+	"math/rand"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/pcap"
+
+	"github.com/hwipl/packet-go/pkg/rawsocket"
+	"github.com/hwipl/packet-go/pkg/tcp"
+)
+
+// PacingFunc computes the delay to wait before sending the packet at index
+// i, given the timestamp gap to the previous packet as recorded in the
+// source (0 if unknown)
+type PacingFunc func(i int, gap time.Duration) time.Duration
+
+// RewriteFunc rewrites a packet's raw bytes before it is sent, e.g. to swap
+// MAC/IP/port so recorded traffic can be re-injected onto a different
+// interface
+type RewriteFunc func(data []byte) []byte
+
+// Replayer transmits a list of raw packets over a RawSocket, honoring
+// either the original inter-packet gaps recorded alongside the packets or a
+// user-provided PacingFunc
+type Replayer struct {
+	// RawSocket is used to transmit every packet
+	RawSocket *rawsocket.RawSocket
+
+	// Pacing, if set, overrides the default pacing derived from Speed,
+	// PPS and Jitter
+	Pacing PacingFunc
+
+	// Speed is a multiplier applied to the original inter-packet gaps;
+	// it is ignored if PPS or Pacing is set. 0 defaults to 1
+	Speed float64
+
+	// PPS, if set, paces packets at a constant rate instead of using the
+	// original inter-packet gaps
+	PPS float64
+
+	// Jitter adds up to +/- Jitter of random noise to every computed
+	// delay
+	Jitter time.Duration
+
+	// Loop replays the packets in an endless loop instead of stopping
+	// after the last one
+	Loop bool
+
+	// MaxPackets stops the replay after this many packets have been
+	// sent; 0 means unlimited
+	MaxPackets int
+
+	// MaxDuration stops the replay after this much time has passed; 0
+	// means unlimited
+	MaxDuration time.Duration
+
+	// Rewrite, if set, is applied to every packet right before it is
+	// sent
+	Rewrite RewriteFunc
+
+	packets [][]byte
+	gaps    []time.Duration
+}
+
+// NewReplayer creates a Replayer that sends packets over sock
+func NewReplayer(sock *rawsocket.RawSocket) *Replayer {
+	return &Replayer{RawSocket: sock}
+}
+
+// LoadConn loads the packets of a synthesized TCP connection conn; since
+// Conn does not record timestamps, packets are sent back to back unless
+// Pacing or PPS is set
+func (r *Replayer) LoadConn(conn *tcp.Conn) {
+	r.packets = conn.Packets
+	r.gaps = make([]time.Duration, len(conn.Packets))
+}
+
+// LoadPcap loads the packets of a pcap file, recording the inter-packet
+// gaps from their original capture timestamps
+func (r *Replayer) LoadPcap(file string) error {
+	handle, err := pcap.OpenOffline(file)
+	if err != nil {
+		return err
+	}
+	defer handle.Close()
+
+	source := gopacket.NewPacketSource(handle, handle.LinkType())
+	var last time.Time
+	for packet := range source.Packets() {
+		ci := packet.Metadata().CaptureInfo
+		var gap time.Duration
+		if !last.IsZero() {
+			gap = ci.Timestamp.Sub(last)
+		}
+		last = ci.Timestamp
+
+		r.packets = append(r.packets, packet.Data())
+		r.gaps = append(r.gaps, gap)
+	}
+	return nil
+}
+
+// delay computes how long to wait before sending packet i
+func (r *Replayer) delay(i int) time.Duration {
+	if r.Pacing != nil {
+		return r.Pacing(i, r.gaps[i])
+	}
+
+	var d time.Duration
+	switch {
+	case r.PPS > 0:
+		d = time.Duration(float64(time.Second) / r.PPS)
+	default:
+		speed := r.Speed
+		if speed <= 0 {
+			speed = 1
+		}
+		d = time.Duration(float64(r.gaps[i]) / speed)
+	}
+
+	if r.Jitter > 0 {
+		d += time.Duration(rand.Int63n(int64(2*r.Jitter))) - r.Jitter
+		if d < 0 {
+			d = 0
+		}
+	}
+	return d
+}
+
+// Run transmits the loaded packets over RawSocket, honoring the configured
+// pacing, loop and stop conditions
+func (r *Replayer) Run() {
+	if r.RawSocket == nil {
+		log.Fatal("no raw socket set")
+	}
+	if len(r.packets) == 0 {
+		log.Fatal("no packets loaded")
+	}
+
+	var stop <-chan time.Time
+	if r.MaxDuration > 0 {
+		stop = time.After(r.MaxDuration)
+	}
+
+	sent := 0
+	for {
+		for i, data := range r.packets {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+
+			if i > 0 || sent > 0 {
+				time.Sleep(r.delay(i))
+			}
+
+			if r.Rewrite != nil {
+				data = r.Rewrite(data)
+			}
+			r.RawSocket.Send(data)
+
+			sent++
+			if r.MaxPackets > 0 && sent == r.MaxPackets {
+				return
+			}
+		}
+		if !r.Loop {
+			return
+		}
+	}
+}
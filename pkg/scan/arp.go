@@ -0,0 +1,205 @@
+// Package scan implements active discovery helpers built on top of
+// rawsocket.RawSocket for transmit and pcap.Listener for receive: ARPScanner
+// discovers hosts on a local subnet, and SYNScanner probes TCP ports on a
+// single target.
+package scan
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"golang.org/x/time/rate"
+
+	"github.com/hwipl/packet-go/pkg/pcap"
+	"github.com/hwipl/packet-go/pkg/rawsocket"
+)
+
+// defaultScanTimeout bounds how long Scan waits for replies when Timeout is
+// left unset, so a caller passing a non-cancelable context (e.g.
+// context.Background()) cannot make it block forever
+const defaultScanTimeout = 5 * time.Second
+
+// ARPScanner sends ARP requests for every host in the local IPv4 subnet of
+// an interface and collects the IP-to-MAC mappings from the replies
+type ARPScanner struct {
+	// Device is the network interface to scan on
+	Device string
+
+	// Timeout bounds how long the scanner waits for replies after
+	// sending the last request; 0 uses defaultScanTimeout
+	Timeout time.Duration
+
+	// Limiter paces how fast ARP requests are sent; nil means no limit
+	Limiter *rate.Limiter
+
+	sock  *rawsocket.RawSocket
+	iface *net.Interface
+	srcIP net.IP
+
+	mu     sync.Mutex
+	result map[string]net.HardwareAddr
+}
+
+// Scan sends ARP requests for every host address in Device's local IPv4
+// subnet and returns the IP-to-MAC mappings seen in replies before ctx is
+// done or Timeout elapses
+func (s *ARPScanner) Scan(ctx context.Context) (map[string]net.HardwareAddr, error) {
+	iface, srcIP, network, err := localIPv4Net(s.Device)
+	if err != nil {
+		return nil, err
+	}
+	s.iface = iface
+	s.srcIP = srcIP
+	s.result = make(map[string]net.HardwareAddr)
+
+	timeout := s.Timeout
+	if timeout <= 0 {
+		timeout = defaultScanTimeout
+	}
+
+	s.sock = rawsocket.NewRawSocket(s.Device)
+	defer s.sock.Close()
+
+	listener := &pcap.Listener{
+		Device:        s.Device,
+		Filter:        "arp",
+		PacketHandler: s,
+	}
+	listener.Prepare()
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		listener.Loop()
+	}()
+
+	for _, ip := range hostAddrs(network) {
+		if ctx.Err() != nil {
+			break
+		}
+		if s.Limiter != nil {
+			if err := s.Limiter.Wait(ctx); err != nil {
+				break
+			}
+		}
+		s.sendRequest(ip)
+	}
+
+	// wait for replies until ctx is done or timeout has passed since the
+	// last request
+	waitCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	<-waitCtx.Done()
+
+	// stop the receive loop and wait for it to actually exit before
+	// reading s.result, since it is written from that goroutine
+	listener.Stop()
+	wg.Wait()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.result, nil
+}
+
+// sendRequest sends a single ARP request for target
+func (s *ARPScanner) sendRequest(target net.IP) {
+	eth := layers.Ethernet{
+		SrcMAC:       s.iface.HardwareAddr,
+		DstMAC:       net.HardwareAddr{0xff, 0xff, 0xff, 0xff, 0xff, 0xff},
+		EthernetType: layers.EthernetTypeARP,
+	}
+	arp := layers.ARP{
+		AddrType:          layers.LinkTypeEthernet,
+		Protocol:          layers.EthernetTypeIPv4,
+		HwAddressSize:     6,
+		ProtAddressSize:   4,
+		Operation:         layers.ARPRequest,
+		SourceHwAddress:   s.iface.HardwareAddr,
+		SourceProtAddress: s.srcIP.To4(),
+		DstHwAddress:      net.HardwareAddr{0, 0, 0, 0, 0, 0},
+		DstProtAddress:    target.To4(),
+	}
+
+	opts := gopacket.SerializeOptions{FixLengths: true}
+	buf := gopacket.NewSerializeBuffer()
+	if err := gopacket.SerializeLayers(buf, opts, &eth, &arp); err != nil {
+		log.Printf("scan: failed to build ARP request for %s: %s",
+			target, err)
+		return
+	}
+	s.sock.Send(buf.Bytes())
+}
+
+// HandlePacket implements pcap.PacketHandler and records ARP replies
+func (s *ARPScanner) HandlePacket(packet gopacket.Packet) {
+	arpLayer := packet.Layer(layers.LayerTypeARP)
+	if arpLayer == nil {
+		return
+	}
+	arp := arpLayer.(*layers.ARP)
+	if arp.Operation != layers.ARPReply {
+		return
+	}
+	ip := net.IP(arp.SourceProtAddress).String()
+	s.mu.Lock()
+	s.result[ip] = net.HardwareAddr(arp.SourceHwAddress)
+	s.mu.Unlock()
+}
+
+// errNoIPv4Addr is returned when an interface has no IPv4 address to scan
+// from
+var errNoIPv4Addr = errors.New("scan: interface has no IPv4 address")
+
+// localIPv4Net returns device's interface, its IPv4 address and the IPv4
+// network it is configured on
+func localIPv4Net(device string) (*net.Interface, net.IP, *net.IPNet, error) {
+	iface, err := net.InterfaceByName(device)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	for _, addr := range addrs {
+		ipNet, ok := addr.(*net.IPNet)
+		if !ok || ipNet.IP.To4() == nil {
+			continue
+		}
+		return iface, ipNet.IP, ipNet, nil
+	}
+	return nil, nil, nil, errNoIPv4Addr
+}
+
+// hostAddrs returns every host address (excluding network and broadcast
+// addresses) in network
+func hostAddrs(network *net.IPNet) []net.IP {
+	var addrs []net.IP
+	ip := network.IP.Mask(network.Mask).To4()
+	for network.Contains(ip) {
+		addrs = append(addrs, append(net.IP{}, ip...))
+		incIP(ip)
+	}
+	if len(addrs) > 2 {
+		// drop network and broadcast address
+		addrs = addrs[1 : len(addrs)-1]
+	}
+	return addrs
+}
+
+// incIP increments ip in place, treating it as a big-endian number
+func incIP(ip net.IP) {
+	for i := len(ip) - 1; i >= 0; i-- {
+		ip[i]++
+		if ip[i] != 0 {
+			break
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package scan
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"golang.org/x/time/rate"
+
+	"github.com/hwipl/packet-go/pkg/pcap"
+	"github.com/hwipl/packet-go/pkg/rawsocket"
+	"github.com/hwipl/packet-go/pkg/tcp"
+)
+
+// PortState is the classification of a scanned port
+type PortState int
+
+// Port states returned by SYNScanner
+const (
+	PortUnknown PortState = iota
+	PortOpen
+	PortClosed
+	PortFiltered
+)
+
+// String implements fmt.Stringer
+func (s PortState) String() string {
+	switch s {
+	case PortOpen:
+		return "open"
+	case PortClosed:
+		return "closed"
+	case PortFiltered:
+		return "filtered"
+	default:
+		return "unknown"
+	}
+}
+
+// SYNScanner sends crafted TCP SYN packets to a list of ports on a target
+// and classifies each port as open, closed or filtered based on whether it
+// sees a SYN-ACK, a RST or nothing within PerTargetTimeout
+type SYNScanner struct {
+	// Device is the network interface the scan is sent from and
+	// received on
+	Device string
+
+	// Client is the source of the SYN packets; its MAC and IP are used
+	// as the scan's source address, its Port as the source port for
+	// every probe
+	Client *tcp.Peer
+
+	// Target is the IP address being scanned
+	Target net.IP
+
+	// TargetMAC is the target's MAC address, e.g. the local router's
+	// MAC if Target is not on the local subnet
+	TargetMAC net.HardwareAddr
+
+	// Ports is the list of TCP ports to probe
+	Ports []uint16
+
+	// PerTargetTimeout bounds how long the scanner waits for a reply to
+	// a single port before classifying it as filtered
+	PerTargetTimeout time.Duration
+
+	// Limiter paces how fast SYN packets are sent; nil means no limit
+	Limiter *rate.Limiter
+
+	sock *rawsocket.RawSocket
+
+	mu      sync.Mutex
+	pending map[uint16]chan PortState
+}
+
+// Scan probes every port in Ports and returns a map from port to the
+// classification observed before ctx is done
+func (s *SYNScanner) Scan(ctx context.Context) (map[uint16]PortState, error) {
+	s.sock = rawsocket.NewRawSocket(s.Device)
+	defer s.sock.Close()
+
+	s.pending = make(map[uint16]chan PortState)
+
+	listener := &pcap.Listener{
+		Device:        s.Device,
+		Filter:        "tcp and src host " + s.Target.String(),
+		PacketHandler: s,
+	}
+	listener.Prepare()
+	defer listener.Stop()
+	go listener.Loop()
+
+	result := make(map[uint16]PortState, len(s.Ports))
+	for _, port := range s.Ports {
+		if ctx.Err() != nil {
+			break
+		}
+		if s.Limiter != nil {
+			if err := s.Limiter.Wait(ctx); err != nil {
+				break
+			}
+		}
+		result[port] = s.probe(ctx, port)
+	}
+	return result, nil
+}
+
+// probe sends a single SYN to port and waits for its classification
+func (s *SYNScanner) probe(ctx context.Context, port uint16) PortState {
+	reply := make(chan PortState, 1)
+	s.mu.Lock()
+	s.pending[port] = reply
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.pending, port)
+		s.mu.Unlock()
+	}()
+
+	server := &tcp.Peer{MAC: s.TargetMAC, IP: s.Target, Port: port}
+	client := *s.Client
+	client.Flags.SYN = true
+
+	data, err := tcp.BuildPacket(&client, server, nil, 64, 64000)
+	if err != nil {
+		return PortUnknown
+	}
+	s.sock.Send(data)
+
+	timeout := s.PerTargetTimeout
+	if timeout <= 0 {
+		timeout = time.Second
+	}
+	select {
+	case state := <-reply:
+		return state
+	case <-time.After(timeout):
+		return PortFiltered
+	case <-ctx.Done():
+		return PortFiltered
+	}
+}
+
+// HandlePacket implements pcap.PacketHandler and classifies replies to
+// outstanding probes
+func (s *SYNScanner) HandlePacket(packet gopacket.Packet) {
+	tcpLayer := packet.Layer(layers.LayerTypeTCP)
+	if tcpLayer == nil {
+		return
+	}
+	h := tcpLayer.(*layers.TCP)
+	port := uint16(h.SrcPort)
+	s.mu.Lock()
+	reply, ok := s.pending[port]
+	s.mu.Unlock()
+	if !ok {
+		return
+	}
+
+	switch {
+	case h.SYN && h.ACK:
+		reply <- PortOpen
+	case h.RST:
+		reply <- PortClosed
+	}
+}
@@ -56,7 +56,8 @@ type Conn struct {
 	// Options contains TCP options for different states of the TCP
 	// connection: SYN stores the options for the initial SYN packet,
 	// SYNACK for the SYNACK packet, ACK for the ACK packet and the
-	// remainder of this connection
+	// remainder of this connection. MSS and window scaling are set this
+	// way too, e.g. by putting a layers.TCPOptionKindMSS option in SYN
 	Options struct {
 		SYN    []layers.TCPOption
 		SYNACK []layers.TCPOption
@@ -65,34 +66,129 @@ type Conn struct {
 
 	// Packets is a list of all packets as byte slices in this connection
 	Packets [][]byte
+
+	// TTL is the IPv4 time to live or IPv6 hop limit set on every packet
+	// of this connection; it defaults to 64 if left at 0
+	TTL uint8
+
+	// Window is the TCP window size advertised on every packet of this
+	// connection; it defaults to 64000 if left at 0
+	Window uint16
+
+	ipID      uint16
+	flowLabel uint32
+}
+
+// ttl returns the configured TTL/hop limit, falling back to 64
+func (c *Conn) ttl() uint8 {
+	if c.TTL != 0 {
+		return c.TTL
+	}
+	return 64
+}
+
+// window returns the configured window size, falling back to 64000
+func (c *Conn) window() uint16 {
+	if c.Window != 0 {
+		return c.Window
+	}
+	return 64000
+}
+
+// isIPv6 reports whether this connection's peers use IPv6 addresses
+func (c *Conn) isIPv6() bool {
+	return c.Client.IP.To4() == nil
+}
+
+// networkLayer creates the IPv4 or IPv6 header for a packet sent from
+// sender to receiver, depending on the address family of the connection's
+// peers
+func (c *Conn) networkLayer(sender, receiver *Peer) (gopacket.NetworkLayer, gopacket.SerializableLayer) {
+	if c.isIPv6() {
+		c.flowLabel++
+		return newIPv6Layer(sender, receiver, c.ttl(), c.flowLabel)
+	}
+
+	c.ipID++
+	return newIPv4Layer(sender, receiver, c.ttl(), c.ipID)
+}
+
+// newIPv6Layer creates an IPv6 header between sender and receiver with hop
+// limit ttl and flow label flowLabel
+func newIPv6Layer(sender, receiver *Peer, ttl uint8, flowLabel uint32) (gopacket.NetworkLayer, gopacket.SerializableLayer) {
+	ip6 := &layers.IPv6{
+		Version:    6,
+		HopLimit:   ttl,
+		NextHeader: layers.IPProtocolTCP,
+		FlowLabel:  flowLabel & 0xfffff,
+		SrcIP:      sender.IP,
+		DstIP:      receiver.IP,
+	}
+	return ip6, ip6
+}
+
+// newIPv4Layer creates an IPv4 header between sender and receiver with TTL
+// ttl and identification id
+func newIPv4Layer(sender, receiver *Peer, ttl uint8, id uint16) (gopacket.NetworkLayer, gopacket.SerializableLayer) {
+	ip4 := &layers.IPv4{
+		Version:  4,
+		Flags:    layers.IPv4DontFragment,
+		Id:       id,
+		TTL:      ttl,
+		Protocol: layers.IPProtocolTCP,
+		SrcIP:    sender.IP,
+		DstIP:    receiver.IP,
+	}
+	return ip4, ip4
+}
+
+// BuildPacket serializes a single Ethernet/IP/TCP packet from sender to
+// receiver carrying payload, using ttl as the IPv4 TTL or IPv6 hop limit
+// and window as the advertised TCP window. Unlike Conn, it is stateless and
+// does not touch sender's or receiver's sequence numbers, which makes it
+// useful for one-off packets such as port scan probes
+func BuildPacket(sender, receiver *Peer, payload []byte, ttl uint8, window uint16) ([]byte, error) {
+	var ipNet gopacket.NetworkLayer
+	var ipSer gopacket.SerializableLayer
+	if sender.IP.To4() == nil {
+		ipNet, ipSer = newIPv6Layer(sender, receiver, ttl, 0)
+	} else {
+		ipNet, ipSer = newIPv4Layer(sender, receiver, ttl, 0)
+	}
+	return serializePacket(sender, receiver, payload, ipNet, ipSer, window)
 }
 
 // createPacket creates a TCP packet between the TCP peers sender and receiver
 // that contains payload
 func (c *Conn) createPacket(sender, receiver *Peer, payload []byte) {
-	// prepare creation of fake packet
-	opts := gopacket.SerializeOptions{
-		FixLengths:       true,
-		ComputeChecksums: true,
+	ipNet, ipSer := c.networkLayer(sender, receiver)
+	data, err := serializePacket(sender, receiver, payload, ipNet, ipSer,
+		c.window())
+	if err != nil {
+		log.Fatal(err)
 	}
 
+	// append packet to the list of all packets
+	c.Packets = append(c.Packets, data)
+}
+
+// serializePacket serializes an Ethernet/IP/TCP packet from sender to
+// receiver carrying payload, using the already constructed IP layer ipNet/
+// ipSer and TCP window window
+func serializePacket(sender, receiver *Peer, payload []byte,
+	ipNet gopacket.NetworkLayer, ipSer gopacket.SerializableLayer,
+	window uint16) ([]byte, error) {
 	// create ethernet header
+	ethType := layers.EthernetTypeIPv4
+	if sender.IP.To4() == nil {
+		ethType = layers.EthernetTypeIPv6
+	}
 	eth := layers.Ethernet{
 		SrcMAC:       sender.MAC,
 		DstMAC:       receiver.MAC,
-		EthernetType: layers.EthernetTypeIPv4,
+		EthernetType: ethType,
 	}
 
-	// create ip header
-	ip := layers.IPv4{
-		Version:  4,
-		Flags:    layers.IPv4DontFragment,
-		Id:       1, // TODO: update? remove?
-		TTL:      64,
-		Protocol: layers.IPProtocolTCP,
-		SrcIP:    sender.IP,
-		DstIP:    receiver.IP,
-	}
 	// create tcp header
 	tcp := layers.TCP{
 		SrcPort: layers.TCPPort(sender.Port),
@@ -102,38 +198,32 @@ func (c *Conn) createPacket(sender, receiver *Peer, payload []byte) {
 		FIN:     sender.Flags.FIN,
 		Seq:     sender.Seq,
 		Ack:     sender.Ack,
-		Window:  64000,
+		Window:  window,
 	}
-	tcp.SetNetworkLayerForChecksum(&ip)
-
-	// add tcp options if present
+	tcp.SetNetworkLayerForChecksum(ipNet)
 	if sender.Options != nil {
 		tcp.Options = sender.Options
 	}
 
 	// serialize packet to buffer
-	var err error
+	opts := gopacket.SerializeOptions{
+		FixLengths:       true,
+		ComputeChecksums: true,
+	}
 	buf := gopacket.NewSerializeBuffer()
 	if payload != nil {
-		// with payload
 		pl := gopacket.Payload(payload)
-		err = gopacket.SerializeLayers(buf, opts, &eth, &ip, &tcp,
-			pl)
+		if err := gopacket.SerializeLayers(buf, opts, &eth, ipSer,
+			&tcp, pl); err != nil {
+			return nil, err
+		}
 	} else {
-		// without payload
-		err = gopacket.SerializeLayers(buf, opts, &eth, &ip, &tcp)
-	}
-	if err != nil {
-		log.Fatal(err)
-	}
-
-	// append packet to the list of all packets
-	packets := make([][]byte, len(c.Packets)+1)
-	for i, p := range c.Packets {
-		packets[i] = p
+		if err := gopacket.SerializeLayers(buf, opts, &eth, ipSer,
+			&tcp); err != nil {
+			return nil, err
+		}
 	}
-	packets[len(packets)-1] = buf.Bytes()
-	c.Packets = packets
+	return buf.Bytes(), nil
 }
 
 // Connect creates the packets of the three way handshake between the peers of